@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// runDaemon registers every syncOption that has a schedule (its own, or
+// rsc.DefaultSchedule) as a cron job, serves /metrics on metricsAddr, and
+// blocks until SIGINT/SIGTERM, at which point it cancels in-flight syncs and
+// waits for them to stop before returning.
+func runDaemon(ctx context.Context, rsc *RepositoriesSyncConfiguration, metricsAddr string) error {
+	daemonCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c := cron.New()
+	metrics := newDaemonMetrics()
+	locks := newSourceLocks()
+
+	scheduled := 0
+	for _, syncOption := range rsc.SyncOptions {
+		syncOption := syncOption
+		schedule := syncOption.Schedule
+		if schedule == "" {
+			schedule = rsc.DefaultSchedule
+		}
+		if schedule == "" {
+			log.Printf("daemon: %s -> %s has no schedule, skipping", syncOption.SourceName, syncOption.DestinationName)
+			continue
+		}
+
+		jobKey := syncOption.SourceName + "->" + syncOption.DestinationName
+		_, err := c.AddFunc(schedule, func() {
+			// Overlapping ticks for the same source serialize on a per-source
+			// mutex, rather than coalescing, so sibling syncOptions sharing a
+			// source (e.g. fanning out to two destinations) both still run.
+			lock := locks.forSource(syncOption.SourceName)
+			lock.Lock()
+			defer lock.Unlock()
+
+			start := time.Now()
+			runErr := doRepositoriesSync(daemonCtx, rsc, syncOption)
+			metrics.recordRun(jobKey, start, runErr)
+			if runErr != nil {
+				log.Printf("daemon: scheduled sync %s failed: %v", jobKey, runErr)
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("daemon: invalid schedule %q for %s: %w", schedule, jobKey, err)
+		}
+		scheduled++
+	}
+	if scheduled == 0 {
+		return fmt.Errorf("daemon: no sync_options have a schedule or default_schedule configured")
+	}
+
+	if metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+		server := &http.Server{Addr: metricsAddr, Handler: mux}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("daemon: metrics server stopped: %v", err)
+			}
+		}()
+	}
+
+	c.Start()
+	log.Printf("daemon: running with %d scheduled job(s)", scheduled)
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	<-sigCh
+
+	log.Print("daemon: signal received, cancelling in-flight syncs and waiting for them to stop")
+	cancel()
+	<-c.Stop().Done()
+	return nil
+}
+
+// sourceLocks hands out one *sync.Mutex per source name, so scheduled jobs
+// sharing a source serialize against each other without blocking jobs for
+// unrelated sources.
+type sourceLocks struct {
+	mu    sync.Mutex
+	bySrc map[string]*sync.Mutex
+}
+
+func newSourceLocks() *sourceLocks {
+	return &sourceLocks{bySrc: make(map[string]*sync.Mutex)}
+}
+
+func (s *sourceLocks) forSource(sourceName string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, ok := s.bySrc[sourceName]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.bySrc[sourceName] = lock
+	}
+	return lock
+}
+
+// daemonMetrics tracks, per "source->destination" job key, enough state to
+// answer a /metrics scrape.
+type daemonMetrics struct {
+	mu        sync.Mutex
+	lastRun   map[string]time.Time
+	successes map[string]int
+	failures  map[string]int
+}
+
+func newDaemonMetrics() *daemonMetrics {
+	return &daemonMetrics{
+		lastRun:   make(map[string]time.Time),
+		successes: make(map[string]int),
+		failures:  make(map[string]int),
+	}
+}
+
+func (m *daemonMetrics) recordRun(jobKey string, runAt time.Time, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastRun[jobKey] = runAt
+	if err != nil {
+		m.failures[jobKey]++
+	} else {
+		m.successes[jobKey]++
+	}
+}
+
+func (m *daemonMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for jobKey, lastRun := range m.lastRun {
+		_, _ = fmt.Fprintf(w, "git_sync_last_run_timestamp_seconds{job=%q} %d\n", jobKey, lastRun.Unix())
+		_, _ = fmt.Fprintf(w, "git_sync_success_total{job=%q} %d\n", jobKey, m.successes[jobKey])
+		_, _ = fmt.Fprintf(w, "git_sync_failure_total{job=%q} %d\n", jobKey, m.failures[jobKey])
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	gohttp "net/http"
+	"os/exec"
+	"time"
+)
+
+const (
+	HookTypeWebhook = "webhook"
+	HookTypeExec    = "exec"
+)
+
+// HookSpec names one notification target. Webhook targets are URLs POSTed
+// to with a JSON body; exec targets are executables that receive the same
+// body on stdin.
+type HookSpec struct {
+	Type   string `json:"type"`
+	Target string `json:"target"`
+	Secret string `json:"secret"` // webhook only: HMAC-SHA256 signing key
+}
+
+// HooksConfiguration groups the hooks fired after a sync attempt.
+// OnSuccess and OnFailure fire once per attempt based on its outcome;
+// OnRefChanged additionally fires whenever the fetch actually moved a ref.
+type HooksConfiguration struct {
+	OnSuccess    []*HookSpec `json:"on_success"`
+	OnFailure    []*HookSpec `json:"on_failure"`
+	OnRefChanged []*HookSpec `json:"on_ref_changed"`
+}
+
+// RefChange describes one ref that moved during a fetch. Old or New is
+// empty for a ref that was created or deleted, respectively.
+type RefChange struct {
+	Name string `json:"name"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// syncEventPayload is the JSON body sent to hooks for a single sync attempt.
+type syncEventPayload struct {
+	Source      string      `json:"source"`
+	Destination string      `json:"destination"`
+	Refs        []RefChange `json:"refs"`
+	Duration    string      `json:"duration"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// fireSyncHooks notifies rsc.Hooks about the outcome of one
+// RepositorySyncOption attempt. Failures to deliver a hook are logged, not
+// propagated — a broken webhook shouldn't fail the sync it's reporting on.
+func fireSyncHooks(rsc *RepositoriesSyncConfiguration, syncOption *RepositorySyncOption, refs []RefChange, duration time.Duration, syncErr error) {
+	if rsc.Hooks == nil {
+		return
+	}
+
+	payload := syncEventPayload{
+		Source:      syncOption.SourceName,
+		Destination: syncOption.DestinationName,
+		Refs:        refs,
+		Duration:    duration.String(),
+	}
+	if syncErr != nil {
+		payload.Error = syncErr.Error()
+	}
+
+	var hooks []*HookSpec
+	if syncErr != nil {
+		hooks = append(hooks, rsc.Hooks.OnFailure...)
+	} else {
+		hooks = append(hooks, rsc.Hooks.OnSuccess...)
+	}
+	if len(refs) > 0 {
+		hooks = append(hooks, rsc.Hooks.OnRefChanged...)
+	}
+
+	for _, hook := range hooks {
+		if err := fireHook(hook, payload); err != nil {
+			log.Printf("hooks: %s %q failed: %v", hook.Type, hook.Target, err)
+		}
+	}
+}
+
+func fireHook(hook *HookSpec, payload syncEventPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	switch hook.Type {
+	case HookTypeWebhook:
+		return fireWebhookHook(hook, body)
+	case HookTypeExec:
+		return fireExecHook(hook, body)
+	default:
+		return fmt.Errorf("hooks: unknown hook type %q", hook.Type)
+	}
+}
+
+// fireWebhookHook POSTs body to hook.Target, signing it with
+// X-Hub-Signature-256 when hook.Secret is set.
+func fireWebhookHook(hook *HookSpec, body []byte) error {
+	req, err := gohttp.NewRequest(gohttp.MethodPost, hook.Target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if hook.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(hook.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := gohttp.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned %s", hook.Target, resp.Status)
+	}
+	return nil
+}
+
+// fireExecHook runs hook.Target with body on its stdin.
+func fireExecHook(hook *HookSpec, body []byte) error {
+	cmd := exec.Command(hook.Target)
+	cmd.Stdin = bytes.NewReader(body)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("exec %s: %w (%s)", hook.Target, err, stderr.String())
+	}
+	return nil
+}
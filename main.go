@@ -3,19 +3,48 @@ package main
 import (
 	"context"
 	"crypto/sha256"
+	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net"
+	gohttp "net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	gitclient "github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
 	ssh2 "golang.org/x/crypto/ssh"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+
+	"git_sync/sinks"
+)
+
+const (
+	RepoAuthTypeSsh       = "ssh"
+	RepoAuthTypeHttpToken = "http-token"
+	RepoAuthTypeHttpBasic = "http-basic"
+	RepoAuthTypeAnonymous = "anonymous"
 )
 
 func main() {
+	daemonMode := flag.Bool("daemon", false, "run continuously, syncing each repository on its configured schedule")
+	metricsAddr := flag.String("metrics-addr", ":9090", "address to serve /metrics on in daemon mode")
+	flag.Parse()
+
 	ctx := context.Background()
 
 	rsc, err := readRepositoriesSyncConfiguration("config.json")
@@ -23,31 +52,59 @@ func main() {
 		log.Fatal(err)
 	}
 
-	for _, e := range rsc.SyncOptions {
-		err = doRepositoriesSync(ctx, rsc, e)
-		if err != nil {
+	if *daemonMode {
+		if err = runDaemon(ctx, rsc, *metricsAddr); err != nil {
 			log.Fatal(err)
 		}
+		return
+	}
+
+	results := runRepositoriesSync(ctx, rsc)
+	printSyncSummary(results)
+
+	for _, result := range results {
+		if result.Err != nil {
+			os.Exit(1)
+		}
 	}
 }
 
 type RepositoryAccess struct {
 	RepoName                  string `json:"repo_name"`
 	RepoUrl                   string `json:"repo_url"`
+	RepoAuthType              string `json:"repo_auth_type"`
 	RepoPemFileName           string `json:"repo_pem_file_name"`
 	RepoPemFilePassword       string `json:"repo_pem_file_password"`
 	RepoSkipHostKeyValidation bool   `json:"repo_skip_host_key_validation"`
+	RepoHttpUsername          string `json:"repo_http_username"`
+	RepoHttpPassword          string `json:"repo_http_password"`
+	RepoHttpToken             string `json:"repo_http_token"`
+	RepoInsecureSkipTls       bool   `json:"repo_insecure_skip_tls"`
+	RepoUseSshAgent           bool   `json:"repo_use_ssh_agent"`
 }
 
 type RepositorySyncOption struct {
 	SourceName      string `json:"source_name"`
 	DestinationName string `json:"destination_name"`
+	LFS             bool   `json:"lfs"`
+	Schedule        string `json:"schedule"`
+
+	// Destinations fans one source out to multiple Sinks in a single fetch.
+	// When empty, destinationsFor builds a single git-remote destination
+	// from DestinationName, preserving the original one-to-one behavior.
+	Destinations []*DestinationSpec `json:"destinations"`
 }
 
 type RepositoriesSyncConfiguration struct {
 	ShadowsLocationBasePath string                  `json:"shadows_location_base_path"`
 	Repositories            []*RepositoryAccess     `json:"repositories"`
 	SyncOptions             []*RepositorySyncOption `json:"sync_options"`
+	Concurrency             int                     `json:"concurrency"`
+	MaxRetries              int                     `json:"max_retries"`
+	RetryBackoff            string                  `json:"retry_backoff"`
+	JobTimeout              string                  `json:"job_timeout"`
+	DefaultSchedule         string                  `json:"default_schedule"`
+	Hooks                   *HooksConfiguration     `json:"hooks"`
 }
 
 func (rsc *RepositoriesSyncConfiguration) getRepositoryAccess(repoName string) *RepositoryAccess {
@@ -111,6 +168,84 @@ func repositorySshKeyRead(sourceRepoPemFileName string, sourceRepoPemFilePasswor
 	return sourceRepoPublicKey, nil
 }
 
+// repositoryAuthMethod builds the go-git auth method for a repository from its
+// configured RepoAuthType, falling back to SSH (the historical default) when
+// the field is left empty so existing configs keep working. It also returns
+// the URL that should actually be dialed, since SSH auth resolved from
+// ~/.ssh/config can rewrite the configured host/port.
+func repositoryAuthMethod(access *RepositoryAccess) (transport.AuthMethod, string, error) {
+	authType := access.RepoAuthType
+	if authType == "" {
+		authType = RepoAuthTypeSsh
+	}
+
+	switch authType {
+	case RepoAuthTypeSsh:
+		return repositorySshAuth(access)
+	case RepoAuthTypeHttpToken:
+		repositoryInstallInsecureHttpClient(access.RepoUrl, access.RepoInsecureSkipTls)
+		return &githttp.BasicAuth{
+			Username: access.RepoHttpUsername,
+			Password: access.RepoHttpToken,
+		}, access.RepoUrl, nil
+	case RepoAuthTypeHttpBasic:
+		repositoryInstallInsecureHttpClient(access.RepoUrl, access.RepoInsecureSkipTls)
+		return &githttp.BasicAuth{
+			Username: access.RepoHttpUsername,
+			Password: access.RepoHttpPassword,
+		}, access.RepoUrl, nil
+	case RepoAuthTypeAnonymous:
+		repositoryInstallInsecureHttpClient(access.RepoUrl, access.RepoInsecureSkipTls)
+		return nil, access.RepoUrl, nil
+	default:
+		return nil, "", fmt.Errorf("repository %q: unknown repo_auth_type %q", access.RepoName, access.RepoAuthType)
+	}
+}
+
+// go-git's HTTP transport is configured per-protocol rather than per-repo, so
+// a single client is installed once (installScopedClients) and consults
+// insecureTlsHosts on every request to decide whether to skip certificate
+// verification for that host.
+var (
+	insecureTlsHosts     sync.Map // host -> struct{}, hosts that opted into repo_insecure_skip_tls
+	installScopedClients sync.Once
+)
+
+// repositoryInstallInsecureHttpClient records repoUrl's host as TLS-insecure
+// when requested, and makes sure go-git's http/https transports consult that
+// per-host set instead of skipping certificate verification for every
+// repository synced in this process.
+func repositoryInstallInsecureHttpClient(repoUrl string, insecureSkipTls bool) {
+	installScopedClients.Do(installPerHostTlsClients)
+
+	if !insecureSkipTls {
+		return
+	}
+	if u, err := url.Parse(repoUrl); err == nil && u.Hostname() != "" {
+		insecureTlsHosts.Store(u.Hostname(), struct{}{})
+	}
+}
+
+// installPerHostTlsClients registers an http.Client for the http/https
+// schemes whose RoundTripper only skips certificate verification for hosts
+// present in insecureTlsHosts, leaving every other repo's verification
+// untouched.
+func installPerHostTlsClients() {
+	client := &gohttp.Client{Transport: &perHostTlsRoundTripper{}}
+	gitclient.InstallProtocol("https", githttp.NewClient(client))
+	gitclient.InstallProtocol("http", githttp.NewClient(client))
+}
+
+type perHostTlsRoundTripper struct{}
+
+func (t *perHostTlsRoundTripper) RoundTrip(req *gohttp.Request) (*gohttp.Response, error) {
+	transport := gohttp.DefaultTransport.(*gohttp.Transport).Clone()
+	if _, insecure := insecureTlsHosts.Load(req.URL.Hostname()); insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return transport.RoundTrip(req)
+}
+
 func repositoryShadowCheckInit(sourceClonePath string) (*git.Repository, error) {
 	r, err := git.PlainOpen(sourceClonePath)
 	if err != nil && err != git.ErrRepositoryNotExists {
@@ -122,7 +257,7 @@ func repositoryShadowCheckInit(sourceClonePath string) (*git.Repository, error)
 	return r, nil
 }
 
-func repositoryShadowInit(ctx context.Context, sourceClonePath string, sourceRepoUrl string, sourceRepoPublicKey *ssh.PublicKeys) (*git.Repository, error) {
+func repositoryShadowInit(ctx context.Context, sourceClonePath string, sourceRepoUrl string, sourceRepoAuth transport.AuthMethod) (*git.Repository, error) {
 	r, err := git.PlainInit(sourceClonePath, true)
 	if err != nil {
 		return nil, err
@@ -140,7 +275,7 @@ func repositoryShadowInit(ctx context.Context, sourceClonePath string, sourceRep
 	}
 
 	err = remoteSource.FetchContext(ctx, &git.FetchOptions{
-		Auth:     sourceRepoPublicKey,
+		Auth:     sourceRepoAuth,
 		Progress: os.Stdout,
 	})
 	if err != nil && err != git.NoErrAlreadyUpToDate {
@@ -150,14 +285,14 @@ func repositoryShadowInit(ctx context.Context, sourceClonePath string, sourceRep
 	return r, nil
 }
 
-func repositoryShadowUpdate(ctx context.Context, r *git.Repository, sourceClonePath string, sourceRepoPublicKey *ssh.PublicKeys) (*git.Repository, error) {
+func repositoryShadowUpdate(ctx context.Context, r *git.Repository, sourceClonePath string, sourceRepoAuth transport.AuthMethod) (*git.Repository, error) {
 	r, err := git.PlainOpen(sourceClonePath)
 	if err != nil {
 		return nil, err
 	}
 
 	err = r.FetchContext(ctx, &git.FetchOptions{
-		Auth:       sourceRepoPublicKey,
+		Auth:       sourceRepoAuth,
 		RemoteName: git.DefaultRemoteName,
 		Progress:   os.Stdout,
 	})
@@ -168,71 +303,176 @@ func repositoryShadowUpdate(ctx context.Context, r *git.Repository, sourceCloneP
 	return r, nil
 }
 
-func repositoryShadowPushToNewOrigin(ctx context.Context, r *git.Repository, destinationRepoUrl string, destinationRepoPublicKey *ssh.PublicKeys) error {
-	remoteDestination, err := r.Remote(git.DefaultRemoteName)
-	if err != nil && err != git.ErrRemoteNotFound {
+// doRepositoriesSync drives a gogitSyncer through one source repository and
+// pushes the result to every Sink the syncOption names (see destinationsFor).
+func doRepositoriesSync(ctx context.Context, rsc *RepositoriesSyncConfiguration, syncOption *RepositorySyncOption) (err error) {
+	var syncer Syncer = &gogitSyncer{}
+	start := time.Now()
+	defer func() {
+		fireSyncHooks(rsc, syncOption, syncer.RefChanges(), time.Since(start), err)
+	}()
+
+	if err = syncer.Prepare(ctx, rsc, syncOption); err != nil {
 		return err
 	}
-	remoteDestination.Config().URLs = []string{
-		destinationRepoUrl,
-	}
+	defer func() { _ = syncer.Cleanup(ctx) }()
 
-	err = remoteDestination.PushContext(ctx, &git.PushOptions{
-		Auth:     destinationRepoPublicKey,
-		Progress: os.Stdout,
-		RefSpecs: []config.RefSpec{
-			"+refs/*:refs/*",
-		},
-	})
-	if err != nil && err != git.NoErrAlreadyUpToDate {
+	if err = syncer.Fetch(ctx); err != nil {
 		return err
 	}
 
+	for _, dest := range destinationsFor(syncOption) {
+		var sink sinks.Sink
+		sink, err = buildSink(rsc, syncOption, dest)
+		if err != nil {
+			return err
+		}
+		if err = syncer.Push(ctx, sink); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func doRepositoriesSync(ctx context.Context, rsc *RepositoriesSyncConfiguration, syncOption *RepositorySyncOption) error {
-	syncOptionSource := rsc.getRepositoryAccess(syncOption.SourceName)
-	syncOptionDestination := rsc.getRepositoryAccess(syncOption.DestinationName)
+// syncJobResult records the outcome of one RepositorySyncOption run, used to
+// build the end-of-run summary table.
+type syncJobResult struct {
+	SourceName      string
+	DestinationName string
+	Retries         int
+	Duration        time.Duration
+	Err             error
+}
 
-	sourceClonePath, err := repositoryShadowCreateDir(syncOptionSource.RepoUrl, rsc.ShadowsLocationBasePath)
-	if err != nil {
-		return err
+// runRepositoriesSync fans syncOptions out across a pool of rsc.Concurrency
+// workers and collects one syncJobResult per job. It never aborts early: a
+// failing job is recorded and the rest keep running.
+func runRepositoriesSync(ctx context.Context, rsc *RepositoriesSyncConfiguration) []*syncJobResult {
+	concurrency := rsc.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
 	}
 
-	sourceRepoPublicKeys, err := repositorySshKeyRead(
-		syncOptionSource.RepoPemFileName,
-		syncOptionSource.RepoPemFilePassword,
-		syncOptionSource.RepoSkipHostKeyValidation,
-	)
-	if err != nil {
-		return err
+	jobs := make(chan *RepositorySyncOption)
+	results := make(chan *syncJobResult, len(rsc.SyncOptions))
+	locks := newSourceLocks()
+
+	var workers sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for syncOption := range jobs {
+				// Sibling syncOptions sharing a source (e.g. fanning out to two
+				// destinations) can land on different workers; serialize them on
+				// a per-source mutex so they never open/fetch/push the same
+				// shadow clone concurrently, same as daemon.go's scheduler.
+				lock := locks.forSource(syncOption.SourceName)
+				lock.Lock()
+				result := runRepositorySyncWithRetry(ctx, rsc, syncOption)
+				lock.Unlock()
+				results <- result
+			}
+		}()
 	}
 
-	r, err := repositoryShadowCheckInit(sourceClonePath)
-	if err != nil {
-		return err
+	for _, syncOption := range rsc.SyncOptions {
+		jobs <- syncOption
+	}
+	close(jobs)
+	workers.Wait()
+	close(results)
+
+	all := make([]*syncJobResult, 0, len(rsc.SyncOptions))
+	for result := range results {
+		all = append(all, result)
 	}
+	return all
+}
 
-	if r == nil {
-		r, err = repositoryShadowInit(ctx, sourceClonePath, syncOptionSource.RepoUrl, sourceRepoPublicKeys)
-	} else {
-		r, err = repositoryShadowUpdate(ctx, r, sourceClonePath, sourceRepoPublicKeys)
+// runRepositorySyncWithRetry runs doRepositoriesSync for a single syncOption,
+// retrying transient failures up to rsc.MaxRetries times with exponential
+// backoff and jitter, and bounding each attempt with rsc.JobTimeout.
+func runRepositorySyncWithRetry(ctx context.Context, rsc *RepositoriesSyncConfiguration, syncOption *RepositorySyncOption) *syncJobResult {
+	result := &syncJobResult{SourceName: syncOption.SourceName, DestinationName: syncOption.DestinationName}
+	backoffBase := repositoryRetryBackoffBase(rsc.RetryBackoff)
+	start := time.Now()
+
+	for attempt := 0; ; attempt++ {
+		jobCtx, cancel := repositoryJobContext(ctx, rsc.JobTimeout)
+		err := doRepositoriesSync(jobCtx, rsc, syncOption)
+		cancel()
+
+		if err == nil || !isTransientSyncError(err) || attempt >= rsc.MaxRetries {
+			result.Err = err
+			result.Retries = attempt
+			break
+		}
+
+		sleep := backoffBase * time.Duration(1<<uint(attempt))
+		if backoffBase > 0 {
+			sleep += time.Duration(rand.Int63n(int64(backoffBase)))
+		}
+		log.Printf("sync %s -> %s failed (attempt %d/%d), retrying in %s: %v",
+			syncOption.SourceName, syncOption.DestinationName, attempt+1, rsc.MaxRetries, sleep, err)
+		time.Sleep(sleep)
 	}
 
-	destinationRepoPublicKeys, err := repositorySshKeyRead(
-		syncOptionDestination.RepoPemFileName,
-		syncOptionDestination.RepoPemFilePassword,
-		syncOptionDestination.RepoSkipHostKeyValidation,
-	)
+	result.Duration = time.Since(start)
+	return result
+}
+
+// repositoryJobContext derives a per-job context from ctx, applying
+// jobTimeout (a time.ParseDuration string) when one is configured.
+func repositoryJobContext(ctx context.Context, jobTimeout string) (context.Context, context.CancelFunc) {
+	if jobTimeout == "" {
+		return context.WithCancel(ctx)
+	}
+	d, err := time.ParseDuration(jobTimeout)
 	if err != nil {
-		return err
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeout(ctx, d)
+}
 
-	err = repositoryShadowPushToNewOrigin(ctx, r, syncOptionDestination.RepoUrl, destinationRepoPublicKeys)
+// repositoryRetryBackoffBase parses retryBackoff (a time.ParseDuration
+// string), defaulting to one second when it's empty or invalid.
+func repositoryRetryBackoffBase(retryBackoff string) time.Duration {
+	if retryBackoff == "" {
+		return time.Second
+	}
+	d, err := time.ParseDuration(retryBackoff)
 	if err != nil {
-		return err
+		return time.Second
 	}
+	return d
+}
 
-	return nil
+// isTransientSyncError reports whether err looks like a network blip or a
+// transport protocol hiccup worth retrying, as opposed to a permanent
+// configuration or auth failure.
+func isTransientSyncError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return strings.Contains(err.Error(), "packp")
+}
+
+// printSyncSummary prints a source -> destination status table covering
+// every job's outcome, duration and retry count.
+func printSyncSummary(results []*syncJobResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer func() { _ = w.Flush() }()
+
+	_, _ = fmt.Fprintln(w, "SOURCE\tDESTINATION\tSTATUS\tDURATION\tRETRIES")
+	for _, result := range results {
+		status := "ok"
+		if result.Err != nil {
+			status = fmt.Sprintf("failed: %v", result.Err)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n",
+			result.SourceName, result.DestinationName, status, result.Duration.Round(time.Millisecond), result.Retries)
+	}
 }
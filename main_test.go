@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRepositoryRetryBackoffBase(t *testing.T) {
+	tests := []struct {
+		name         string
+		retryBackoff string
+		want         time.Duration
+	}{
+		{name: "empty defaults to one second", retryBackoff: "", want: time.Second},
+		{name: "invalid defaults to one second", retryBackoff: "not-a-duration", want: time.Second},
+		{name: "zero duration is honored", retryBackoff: "0s", want: 0},
+		{name: "parses a configured value", retryBackoff: "5s", want: 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := repositoryRetryBackoffBase(tt.retryBackoff); got != tt.want {
+				t.Errorf("repositoryRetryBackoffBase(%q) = %v, want %v", tt.retryBackoff, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTransientSyncError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "packp protocol error", err: errors.New("unexpected EOF while parsing packp"), want: true},
+		{name: "permanent auth error", err: errors.New("authentication required"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientSyncError(tt.err); got != tt.want {
+				t.Errorf("isTransientSyncError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepositoryJobContext(t *testing.T) {
+	parent := context.Background()
+
+	ctx, cancel := repositoryJobContext(parent, "")
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("repositoryJobContext with no jobTimeout should not set a deadline")
+	}
+
+	ctx, cancel = repositoryJobContext(parent, "invalid")
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("repositoryJobContext with an invalid jobTimeout should not set a deadline")
+	}
+
+	ctx, cancel = repositoryJobContext(parent, "1m")
+	defer cancel()
+	if _, ok := ctx.Deadline(); !ok {
+		t.Error("repositoryJobContext with a valid jobTimeout should set a deadline")
+	}
+}
@@ -0,0 +1,133 @@
+package sinks
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// archiveZip writes every file under srcDir into a zip archive at destPath,
+// preserving paths relative to srcDir.
+func archiveZip(srcDir string, destPath string) error {
+	out, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = out.Close() }()
+
+	zw := zip.NewWriter(out)
+	defer func() { _ = zw.Close() }()
+
+	return filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		w, err := zw.Create(relPath)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+
+		_, err = io.Copy(w, f)
+		return err
+	})
+}
+
+// archiveTarZst writes every file under srcDir into a zstd-compressed tar
+// archive at destPath, preserving paths relative to srcDir.
+func archiveTarZst(srcDir string, destPath string) error {
+	out, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = out.Close() }()
+
+	zw, err := zstd.NewWriter(out)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = zw.Close() }()
+
+	tw := tar.NewWriter(zw)
+	defer func() { _ = tw.Close() }()
+
+	return filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = relPath
+		if err = tw.WriteHeader(header); err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// pruneArchives deletes the oldest archives named
+// "<dir>/<namePrefix><timestamp>.<ext>" once more than keep remain, relying on
+// the sortable timestamp suffix archiveTimestamp produces. Files whose name
+// continues past namePrefix with anything other than such a timestamp (e.g.
+// a sibling repository "<repo>-docs") are left alone.
+func pruneArchives(dir string, namePrefix string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	const timestampLayout = "20060102T150405Z"
+	var matches []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, namePrefix) {
+			continue
+		}
+		rest := name[len(namePrefix):]
+		if len(rest) <= len(timestampLayout) || rest[len(timestampLayout)] != '.' {
+			continue
+		}
+		if _, parseErr := time.Parse(timestampLayout, rest[:len(timestampLayout)]); parseErr == nil {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+
+	if len(matches) <= keep {
+		return nil
+	}
+	for _, name := range matches[:len(matches)-keep] {
+		if err = os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
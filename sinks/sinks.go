@@ -0,0 +1,197 @@
+// Package sinks implements the destinations a synced shadow repository can be
+// pushed to: a live git remote, a structured local bare-repo tree, or a
+// timestamped archive.
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// PushInput carries everything a Sink needs to publish a synced shadow
+// repository: the open go-git handle, its on-disk path, and the source URL
+// it was cloned from (sinks that lay out by hoster/owner/repo need it).
+type PushInput struct {
+	Repository *git.Repository
+	ShadowPath string
+	SourceUrl  string
+}
+
+// Sink publishes a synced shadow repository somewhere.
+type Sink interface {
+	Push(ctx context.Context, in PushInput) error
+}
+
+// LfsPusher pushes LFS objects for a shadow clone to a destination URL. It's
+// satisfied by gitcmd.Runner; defined here to avoid sinks depending on gitcmd.
+type LfsPusher interface {
+	PushAllLfs(ctx context.Context, dir string, destinationUrl string) error
+}
+
+// GitRemoteSink pushes the shadow repository's refs directly to RepoUrl —
+// the sync behavior this tool had before sinks existed.
+type GitRemoteSink struct {
+	RepoUrl   string
+	Auth      transport.AuthMethod
+	LfsRunner LfsPusher
+}
+
+func (s *GitRemoteSink) Push(ctx context.Context, in PushInput) error {
+	remote, err := in.Repository.Remote(git.DefaultRemoteName)
+	if err != nil && err != git.ErrRemoteNotFound {
+		return err
+	}
+	remote.Config().URLs = []string{s.RepoUrl}
+
+	err = remote.PushContext(ctx, &git.PushOptions{
+		Auth:     s.Auth,
+		Progress: os.Stdout,
+		RefSpecs: []config.RefSpec{
+			"+refs/*:refs/*",
+		},
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	if s.LfsRunner != nil {
+		return s.LfsRunner.PushAllLfs(ctx, in.ShadowPath, s.RepoUrl)
+	}
+	return nil
+}
+
+// LocalBareSink mirrors the shadow repository into "<BasePath>/<hoster>/<owner>/<repo>.git",
+// deriving the hoster/owner/repo path from the source URL.
+type LocalBareSink struct {
+	BasePath  string
+	LfsRunner LfsPusher // set when the syncOption has LFS enabled
+}
+
+func (s *LocalBareSink) Push(ctx context.Context, in PushInput) error {
+	hoster, owner, repo, err := parseRepoPath(in.SourceUrl)
+	if err != nil {
+		return err
+	}
+
+	destPath := filepath.Join(s.BasePath, hoster, owner, repo+".git")
+	if err = os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return err
+	}
+	if _, err = os.Stat(destPath); os.IsNotExist(err) {
+		if _, err = git.PlainInit(destPath, true); err != nil {
+			return err
+		}
+	}
+	destUrl := "file://" + destPath
+
+	remote, err := in.Repository.Remote(git.DefaultRemoteName)
+	if err != nil && err != git.ErrRemoteNotFound {
+		return err
+	}
+	remote.Config().URLs = []string{destUrl}
+
+	err = remote.PushContext(ctx, &git.PushOptions{
+		Progress: os.Stdout,
+		RefSpecs: []config.RefSpec{
+			"+refs/*:refs/*",
+		},
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	if s.LfsRunner != nil {
+		return s.LfsRunner.PushAllLfs(ctx, in.ShadowPath, destUrl)
+	}
+	return nil
+}
+
+// ArchiveSink writes a timestamped ".zip" or ".tar.zst" snapshot of the bare
+// shadow repository under "<BasePath>/<hoster>/<owner>/", pruning older
+// archives of the same repository once more than Keep remain.
+type ArchiveSink struct {
+	BasePath string
+	Format   string // "zip" or "tar.zst", default "tar.zst"
+	Keep     int    // 0 means keep every archive
+}
+
+func (s *ArchiveSink) Push(_ context.Context, in PushInput) error {
+	format := s.Format
+	if format == "" {
+		format = "tar.zst"
+	}
+
+	hoster, owner, repo, err := parseRepoPath(in.SourceUrl)
+	if err != nil {
+		return err
+	}
+
+	destDir := filepath.Join(s.BasePath, hoster, owner)
+	if err = os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+
+	namePrefix := repo + "-"
+	archivePath := filepath.Join(destDir, namePrefix+archiveTimestamp()+"."+format)
+
+	switch format {
+	case "zip":
+		err = archiveZip(in.ShadowPath, archivePath)
+	case "tar.zst":
+		err = archiveTarZst(in.ShadowPath, archivePath)
+	default:
+		return fmt.Errorf("sinks: unknown archive_format %q", s.Format)
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.Keep > 0 {
+		return pruneArchives(destDir, namePrefix, s.Keep)
+	}
+	return nil
+}
+
+// archiveTimestamp formats the current UTC time as a fixed-width suffix, so
+// sorting archive filenames as strings orders them by creation time.
+func archiveTimestamp() string {
+	return time.Now().UTC().Format("20060102T150405Z")
+}
+
+// parseRepoPath pulls hoster/owner/repo out of an SSH (scp-like) or HTTPS git
+// URL, e.g. "git@github.com:owner/repo.git" or "https://gitlab.com/owner/repo.git".
+func parseRepoPath(rawUrl string) (hoster string, owner string, repo string, err error) {
+	trimmed := strings.TrimSuffix(rawUrl, ".git")
+
+	if strings.Contains(trimmed, "://") {
+		u, parseErr := url.Parse(trimmed)
+		if parseErr != nil {
+			return "", "", "", fmt.Errorf("sinks: parsing %q: %w", rawUrl, parseErr)
+		}
+		return splitHosterOwnerRepo(u.Host, u.Path, rawUrl)
+	}
+
+	at := strings.Index(trimmed, "@")
+	colon := strings.LastIndex(trimmed, ":")
+	if at == -1 || colon == -1 || colon < at {
+		return "", "", "", fmt.Errorf("sinks: cannot parse %q as a git URL", rawUrl)
+	}
+	return splitHosterOwnerRepo(trimmed[at+1:colon], trimmed[colon+1:], rawUrl)
+}
+
+func splitHosterOwnerRepo(hoster string, path string, rawUrl string) (string, string, string, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 {
+		return "", "", "", fmt.Errorf("sinks: cannot derive owner/repo from %q", rawUrl)
+	}
+	return hoster, parts[len(parts)-2], parts[len(parts)-1], nil
+}
@@ -0,0 +1,65 @@
+package sinks
+
+import "testing"
+
+func TestParseRepoPath(t *testing.T) {
+	tests := []struct {
+		name       string
+		rawUrl     string
+		wantHoster string
+		wantOwner  string
+		wantRepo   string
+		wantErr    bool
+	}{
+		{
+			name:       "scp-like ssh url",
+			rawUrl:     "git@github.com:owner/repo.git",
+			wantHoster: "github.com",
+			wantOwner:  "owner",
+			wantRepo:   "repo",
+		},
+		{
+			name:       "https url",
+			rawUrl:     "https://gitlab.com/owner/repo.git",
+			wantHoster: "gitlab.com",
+			wantOwner:  "owner",
+			wantRepo:   "repo",
+		},
+		{
+			name:       "ssh url without .git suffix",
+			rawUrl:     "ssh://git@host/group/owner/repo",
+			wantHoster: "host",
+			wantOwner:  "owner",
+			wantRepo:   "repo",
+		},
+		{
+			name:    "unparseable url",
+			rawUrl:  "not-a-url",
+			wantErr: true,
+		},
+		{
+			name:    "https url missing owner/repo",
+			rawUrl:  "https://gitlab.com/repo.git",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hoster, owner, repo, err := parseRepoPath(tt.rawUrl)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseRepoPath(%q): expected error, got none", tt.rawUrl)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRepoPath(%q): unexpected error: %v", tt.rawUrl, err)
+			}
+			if hoster != tt.wantHoster || owner != tt.wantOwner || repo != tt.wantRepo {
+				t.Errorf("parseRepoPath(%q) = (%q, %q, %q), want (%q, %q, %q)",
+					tt.rawUrl, hoster, owner, repo, tt.wantHoster, tt.wantOwner, tt.wantRepo)
+			}
+		})
+	}
+}
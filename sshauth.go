@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	gogitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/kevinburke/ssh_config"
+	ssh2 "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// repositorySshAuth builds the SSH auth method (and effective URL) for
+// access, preferring, in order: ssh-agent, an explicit PEM file, then
+// ~/.ssh/config resolution by host.
+func repositorySshAuth(access *RepositoryAccess) (transport.AuthMethod, string, error) {
+	if access.RepoUseSshAgent {
+		auth, err := gogitssh.NewSSHAgentAuth("git")
+		if err != nil {
+			return nil, "", err
+		}
+		if callback, err := repositoryHostKeyCallback(access.RepoSkipHostKeyValidation); err == nil {
+			auth.HostKeyCallback = callback
+		}
+		return auth, access.RepoUrl, nil
+	}
+
+	if access.RepoPemFileName != "" {
+		auth, err := repositorySshKeyRead(access.RepoPemFileName, access.RepoPemFilePassword, access.RepoSkipHostKeyValidation)
+		return auth, access.RepoUrl, err
+	}
+
+	return repositorySshConfigAuth(access)
+}
+
+// repositorySshConfigAuth resolves IdentityFile, User, Port and HostName for
+// access.RepoUrl's host from ~/.ssh/config, used when no repo_pem_file_name
+// is configured. It rewrites the clone URL when ssh_config resolves a
+// different HostName or Port.
+func repositorySshConfigAuth(access *RepositoryAccess) (transport.AuthMethod, string, error) {
+	user, host, port, path, err := parseScpLikeUrl(access.RepoUrl)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resolvedUser := user
+	resolvedHost := host
+	resolvedPort := port
+	var identityFile string
+
+	if cfgUser, _ := ssh_config.GetStrict(host, "User"); cfgUser != "" {
+		resolvedUser = cfgUser
+	}
+	if hostName, _ := ssh_config.GetStrict(host, "HostName"); hostName != "" {
+		resolvedHost = hostName
+	}
+	if cfgPort, _ := ssh_config.GetStrict(host, "Port"); cfgPort != "" && cfgPort != "22" {
+		resolvedPort = cfgPort
+	}
+	if idFile, _ := ssh_config.GetStrict(host, "IdentityFile"); idFile != "" {
+		identityFile = expandHome(idFile)
+	}
+
+	if identityFile == "" {
+		return nil, "", fmt.Errorf("ssh: no repo_pem_file_name set and no IdentityFile resolved from ~/.ssh/config for host %q", host)
+	}
+
+	auth, err := repositorySshKeyRead(identityFile, access.RepoPemFilePassword, access.RepoSkipHostKeyValidation)
+	if err != nil {
+		return nil, "", err
+	}
+	auth.User = resolvedUser
+
+	resolvedUrl := access.RepoUrl
+	if resolvedHost != host || resolvedPort != port {
+		resolvedUrl = formatScpLikeUrl(resolvedUser, resolvedHost, resolvedPort, path)
+	}
+
+	return auth, resolvedUrl, nil
+}
+
+// repositoryHostKeyCallback returns an insecure callback when
+// skipValidation is set, otherwise one backed by ~/.ssh/known_hosts so
+// strict verification actually has something to check against.
+func repositoryHostKeyCallback(skipValidation bool) (ssh2.HostKeyCallback, error) {
+	if skipValidation {
+		return ssh2.InsecureIgnoreHostKey(), nil
+	}
+	return knownhosts.New(expandHome("~/.ssh/known_hosts"))
+}
+
+// parseScpLikeUrl splits an SSH git URL into its user, host, port and path
+// parts. It accepts both the scp-like shorthand ("git@host:owner/repo.git",
+// "git@host:2222/owner/repo.git") and full "ssh://" URLs, including the
+// common portless form ("ssh://git@host/owner/repo.git") that the shorthand
+// parser can't express since it uses ":" to separate host from path.
+func parseScpLikeUrl(rawUrl string) (user string, host string, port string, path string, err error) {
+	if strings.HasPrefix(rawUrl, "ssh://") {
+		return parseSshUrl(rawUrl)
+	}
+
+	at := strings.Index(rawUrl, "@")
+	colon := strings.Index(rawUrl, ":")
+	if at == -1 || colon == -1 || colon < at {
+		return "", "", "", "", fmt.Errorf("ssh: cannot parse %q as an scp-like SSH URL", rawUrl)
+	}
+
+	user = rawUrl[:at]
+	host = rawUrl[at+1 : colon]
+	path = rawUrl[colon+1:]
+	port = "22"
+
+	if slash := strings.Index(path, "/"); slash != -1 {
+		if p, convErr := strconv.Atoi(path[:slash]); convErr == nil {
+			port = strconv.Itoa(p)
+			path = path[slash+1:]
+		}
+	}
+
+	return user, host, port, path, nil
+}
+
+// parseSshUrl parses a full "ssh://[user@]host[:port]/path" URL, defaulting
+// the port to 22 when the URL doesn't specify one.
+func parseSshUrl(rawUrl string) (user string, host string, port string, path string, err error) {
+	u, parseErr := url.Parse(rawUrl)
+	if parseErr != nil {
+		return "", "", "", "", fmt.Errorf("ssh: cannot parse %q: %w", rawUrl, parseErr)
+	}
+
+	host = u.Hostname()
+	path = strings.TrimPrefix(u.Path, "/")
+	if host == "" || path == "" {
+		return "", "", "", "", fmt.Errorf("ssh: cannot parse %q as an SSH URL", rawUrl)
+	}
+
+	user = u.User.Username()
+	port = u.Port()
+	if port == "" {
+		port = "22"
+	}
+
+	return user, host, port, path, nil
+}
+
+// formatScpLikeUrl rebuilds an scp-like SSH URL from its resolved parts.
+func formatScpLikeUrl(user string, host string, port string, path string) string {
+	if port != "" && port != "22" {
+		return fmt.Sprintf("%s@%s:%s/%s", user, host, port, path)
+	}
+	return fmt.Sprintf("%s@%s:%s", user, host, path)
+}
+
+// expandHome expands a leading "~" in path to the current user's home
+// directory, returning path unchanged if it can't be resolved.
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
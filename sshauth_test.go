@@ -0,0 +1,120 @@
+package main
+
+import "testing"
+
+func TestParseScpLikeUrl(t *testing.T) {
+	tests := []struct {
+		name     string
+		rawUrl   string
+		wantUser string
+		wantHost string
+		wantPort string
+		wantPath string
+		wantErr  bool
+	}{
+		{
+			name:     "scp shorthand default port",
+			rawUrl:   "git@github.com:owner/repo.git",
+			wantUser: "git",
+			wantHost: "github.com",
+			wantPort: "22",
+			wantPath: "owner/repo.git",
+		},
+		{
+			name:     "scp shorthand explicit port",
+			rawUrl:   "git@host:2222/owner/repo.git",
+			wantUser: "git",
+			wantHost: "host",
+			wantPort: "2222",
+			wantPath: "owner/repo.git",
+		},
+		{
+			name:     "ssh url with port",
+			rawUrl:   "ssh://git@host:2222/owner/repo.git",
+			wantUser: "git",
+			wantHost: "host",
+			wantPort: "2222",
+			wantPath: "owner/repo.git",
+		},
+		{
+			name:     "ssh url portless",
+			rawUrl:   "ssh://git@host/owner/repo.git",
+			wantUser: "git",
+			wantHost: "host",
+			wantPort: "22",
+			wantPath: "owner/repo.git",
+		},
+		{
+			name:    "no user or colon",
+			rawUrl:  "not-a-url",
+			wantErr: true,
+		},
+		{
+			name:    "colon before at",
+			rawUrl:  "host:path@nope",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, host, port, path, err := parseScpLikeUrl(tt.rawUrl)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseScpLikeUrl(%q): expected error, got none", tt.rawUrl)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseScpLikeUrl(%q): unexpected error: %v", tt.rawUrl, err)
+			}
+			if user != tt.wantUser || host != tt.wantHost || port != tt.wantPort || path != tt.wantPath {
+				t.Errorf("parseScpLikeUrl(%q) = (%q, %q, %q, %q), want (%q, %q, %q, %q)",
+					tt.rawUrl, user, host, port, path, tt.wantUser, tt.wantHost, tt.wantPort, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestParseSshUrl(t *testing.T) {
+	tests := []struct {
+		name    string
+		rawUrl  string
+		wantErr bool
+	}{
+		{name: "missing host", rawUrl: "ssh:///owner/repo.git", wantErr: true},
+		{name: "missing path", rawUrl: "ssh://git@host", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, _, err := parseSshUrl(tt.rawUrl)
+			if tt.wantErr && err == nil {
+				t.Fatalf("parseSshUrl(%q): expected error, got none", tt.rawUrl)
+			}
+		})
+	}
+}
+
+func TestFormatScpLikeUrl(t *testing.T) {
+	tests := []struct {
+		name string
+		user string
+		host string
+		port string
+		path string
+		want string
+	}{
+		{name: "default port omitted", user: "git", host: "host", port: "22", path: "owner/repo.git", want: "git@host:owner/repo.git"},
+		{name: "non-default port included", user: "git", host: "host", port: "2222", path: "owner/repo.git", want: "git@host:2222/owner/repo.git"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatScpLikeUrl(tt.user, tt.host, tt.port, tt.path)
+			if got != tt.want {
+				t.Errorf("formatScpLikeUrl(%q, %q, %q, %q) = %q, want %q", tt.user, tt.host, tt.port, tt.path, got, tt.want)
+			}
+		})
+	}
+}
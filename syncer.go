@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+
+	"git_sync/gitcmd"
+	"git_sync/sinks"
+)
+
+const (
+	SinkTypeGitRemote = "git-remote"
+	SinkTypeLocalBare = "local-bare"
+	SinkTypeArchive   = "archive"
+)
+
+// DestinationSpec names one place a synced source repository should be
+// pushed to. A RepositorySyncOption with no Destinations falls back to a
+// single git-remote destination built from its DestinationName, preserving
+// the tool's original one-source-one-destination behavior.
+type DestinationSpec struct {
+	Type            string `json:"type"`
+	DestinationName string `json:"destination_name"`
+	BasePath        string `json:"base_path"`
+	ArchiveFormat   string `json:"archive_format"`
+	Keep            int    `json:"keep"`
+}
+
+// Syncer drives one source repository through its shadow-clone lifecycle.
+// gogitSyncer, wrapping the original go-git based flow, is the only
+// implementation; the interface exists so the engine can evolve (or be
+// swapped, e.g. for a pure git-cli one) without touching call sites.
+type Syncer interface {
+	Prepare(ctx context.Context, rsc *RepositoriesSyncConfiguration, syncOption *RepositorySyncOption) error
+	Fetch(ctx context.Context) error
+	Push(ctx context.Context, sink sinks.Sink) error
+	Cleanup(ctx context.Context) error
+	// RefChanges reports the ref adds/updates/deletes observed by the most
+	// recent Fetch, for OnRefChanged hooks.
+	RefChanges() []RefChange
+}
+
+// gogitSyncer keeps a shadow (bare, mirror) clone of the source repository on
+// disk, re-fetching it on every sync before handing the open repository to a
+// Sink.
+type gogitSyncer struct {
+	rsc        *RepositoriesSyncConfiguration
+	syncOption *RepositorySyncOption
+
+	shadowPath string
+	sourceUrl  string
+	sourceAuth transport.AuthMethod
+	repo       *git.Repository
+	refChanges []RefChange
+}
+
+func (s *gogitSyncer) Prepare(ctx context.Context, rsc *RepositoriesSyncConfiguration, syncOption *RepositorySyncOption) error {
+	source := rsc.getRepositoryAccess(syncOption.SourceName)
+	if source == nil {
+		return fmt.Errorf("source %q not found in repositories", syncOption.SourceName)
+	}
+
+	shadowPath, err := repositoryShadowCreateDir(source.RepoUrl, rsc.ShadowsLocationBasePath)
+	if err != nil {
+		return err
+	}
+
+	sourceAuth, sourceUrl, err := repositoryAuthMethod(source)
+	if err != nil {
+		return err
+	}
+
+	s.rsc = rsc
+	s.syncOption = syncOption
+	s.shadowPath = shadowPath
+	s.sourceUrl = sourceUrl
+	s.sourceAuth = sourceAuth
+	return nil
+}
+
+func (s *gogitSyncer) Fetch(ctx context.Context) error {
+	r, err := repositoryShadowCheckInit(s.shadowPath)
+	if err != nil {
+		return err
+	}
+	before := refHashesOf(r)
+
+	if r == nil {
+		r, err = repositoryShadowInit(ctx, s.shadowPath, s.sourceUrl, s.sourceAuth)
+	} else {
+		r, err = repositoryShadowUpdate(ctx, r, s.shadowPath, s.sourceAuth)
+	}
+	if err != nil {
+		return err
+	}
+	s.repo = r
+	s.refChanges = diffRefHashes(before, refHashesOf(r))
+
+	if s.syncOption.LFS {
+		source := s.rsc.getRepositoryAccess(s.syncOption.SourceName)
+		lfsRunner, err := gitcmdRunnerFor(source)
+		if err != nil {
+			return err
+		}
+		if err = lfsRunner.FetchAllLfs(ctx, s.shadowPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *gogitSyncer) Push(ctx context.Context, sink sinks.Sink) error {
+	return sink.Push(ctx, sinks.PushInput{
+		Repository: s.repo,
+		ShadowPath: s.shadowPath,
+		SourceUrl:  s.sourceUrl,
+	})
+}
+
+func (s *gogitSyncer) Cleanup(_ context.Context) error {
+	return nil
+}
+
+// RefChanges returns the ref adds/updates/deletes observed by the most
+// recent Fetch, for hooks.go's OnRefChanged firing.
+func (s *gogitSyncer) RefChanges() []RefChange {
+	return s.refChanges
+}
+
+// refHashesOf maps the name of every hash ref in r to the hash it points at;
+// symbolic refs such as HEAD are skipped. A nil r (no shadow repo yet) yields
+// an empty map, so its refs diff as pure adds.
+func refHashesOf(r *git.Repository) map[string]string {
+	hashes := make(map[string]string)
+	if r == nil {
+		return hashes
+	}
+
+	refs, err := r.References()
+	if err != nil {
+		return hashes
+	}
+	_ = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			hashes[ref.Name().String()] = ref.Hash().String()
+		}
+		return nil
+	})
+	return hashes
+}
+
+// diffRefHashes compares two refHashesOf snapshots and returns one
+// RefChange per added, updated or deleted ref.
+func diffRefHashes(before map[string]string, after map[string]string) []RefChange {
+	var changes []RefChange
+
+	for name, newHash := range after {
+		if oldHash, existed := before[name]; !existed {
+			changes = append(changes, RefChange{Name: name, New: newHash})
+		} else if oldHash != newHash {
+			changes = append(changes, RefChange{Name: name, Old: oldHash, New: newHash})
+		}
+	}
+	for name, oldHash := range before {
+		if _, stillExists := after[name]; !stillExists {
+			changes = append(changes, RefChange{Name: name, Old: oldHash})
+		}
+	}
+
+	return changes
+}
+
+// destinationsFor returns syncOption.Destinations, or, when empty, a single
+// git-remote DestinationSpec built from its (legacy) DestinationName.
+func destinationsFor(syncOption *RepositorySyncOption) []*DestinationSpec {
+	if len(syncOption.Destinations) > 0 {
+		return syncOption.Destinations
+	}
+	return []*DestinationSpec{{
+		Type:            SinkTypeGitRemote,
+		DestinationName: syncOption.DestinationName,
+	}}
+}
+
+// gitcmdRunnerFor builds a gitcmd.Runner for access's LFS fetch/push calls,
+// carrying over whichever credentials repositoryAuthMethod would use for the
+// regular go-git fetch/push: the PEM file for SSH, or the resolved HTTP
+// username/password (or token) for http-token/http-basic, so the shelled-out
+// "git lfs" subprocess can authenticate the same way.
+func gitcmdRunnerFor(access *RepositoryAccess) (*gitcmd.Runner, error) {
+	runner, err := gitcmd.NewRunner(access.RepoPemFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	switch access.RepoAuthType {
+	case RepoAuthTypeHttpToken:
+		runner.WithHttpAuth(access.RepoHttpUsername, access.RepoHttpToken)
+	case RepoAuthTypeHttpBasic:
+		runner.WithHttpAuth(access.RepoHttpUsername, access.RepoHttpPassword)
+	}
+
+	return runner, nil
+}
+
+// buildSink constructs the Sink described by dest, resolving git-remote auth
+// and LFS pushing against rsc's repositories.
+func buildSink(rsc *RepositoriesSyncConfiguration, syncOption *RepositorySyncOption, dest *DestinationSpec) (sinks.Sink, error) {
+	switch dest.Type {
+	case SinkTypeGitRemote, "":
+		destination := rsc.getRepositoryAccess(dest.DestinationName)
+		if destination == nil {
+			return nil, fmt.Errorf("destination %q not found in repositories", dest.DestinationName)
+		}
+
+		auth, resolvedUrl, err := repositoryAuthMethod(destination)
+		if err != nil {
+			return nil, err
+		}
+
+		sink := &sinks.GitRemoteSink{RepoUrl: resolvedUrl, Auth: auth}
+		if syncOption.LFS {
+			lfsRunner, err := gitcmdRunnerFor(destination)
+			if err != nil {
+				return nil, err
+			}
+			sink.LfsRunner = lfsRunner
+		}
+		return sink, nil
+
+	case SinkTypeLocalBare:
+		sink := &sinks.LocalBareSink{BasePath: dest.BasePath}
+		if syncOption.LFS {
+			// A plain go-git push only carries LFS pointer files, not the blob
+			// content, so local-bare destinations need the same gitcmd LFS push
+			// git-remote destinations get.
+			lfsRunner, err := gitcmd.NewRunner("")
+			if err != nil {
+				return nil, err
+			}
+			sink.LfsRunner = lfsRunner
+		}
+		return sink, nil
+
+	case SinkTypeArchive:
+		return &sinks.ArchiveSink{BasePath: dest.BasePath, Format: dest.ArchiveFormat, Keep: dest.Keep}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown destination type %q", dest.Type)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestDiffRefHashes(t *testing.T) {
+	before := map[string]string{
+		"refs/heads/main":    "aaa",
+		"refs/heads/removed": "bbb",
+		"refs/heads/stable":  "ccc",
+	}
+	after := map[string]string{
+		"refs/heads/main":   "aaa", // unchanged
+		"refs/heads/stable": "ddd", // updated
+		"refs/heads/added":  "eee", // added
+	}
+
+	changes := diffRefHashes(before, after)
+
+	byName := make(map[string]RefChange, len(changes))
+	for _, c := range changes {
+		byName[c.Name] = c
+	}
+
+	if _, ok := byName["refs/heads/main"]; ok {
+		t.Error("unchanged ref refs/heads/main should not appear in the diff")
+	}
+
+	added, ok := byName["refs/heads/added"]
+	if !ok || added.Old != "" || added.New != "eee" {
+		t.Errorf("refs/heads/added change = %+v, want Old=\"\" New=\"eee\"", added)
+	}
+
+	updated, ok := byName["refs/heads/stable"]
+	if !ok || updated.Old != "ccc" || updated.New != "ddd" {
+		t.Errorf("refs/heads/stable change = %+v, want Old=\"ccc\" New=\"ddd\"", updated)
+	}
+
+	removed, ok := byName["refs/heads/removed"]
+	if !ok || removed.Old != "bbb" || removed.New != "" {
+		t.Errorf("refs/heads/removed change = %+v, want Old=\"bbb\" New=\"\"", removed)
+	}
+
+	if len(changes) != 3 {
+		names := make([]string, 0, len(changes))
+		for _, c := range changes {
+			names = append(names, c.Name)
+		}
+		sort.Strings(names)
+		t.Errorf("expected 3 changes, got %d: %v", len(changes), names)
+	}
+}
+
+func TestDiffRefHashesEmptyBefore(t *testing.T) {
+	after := map[string]string{"refs/heads/main": "aaa"}
+	changes := diffRefHashes(map[string]string{}, after)
+	if len(changes) != 1 || changes[0].Name != "refs/heads/main" || changes[0].New != "aaa" || changes[0].Old != "" {
+		t.Errorf("diffRefHashes with empty before = %+v, want single add of refs/heads/main", changes)
+	}
+}